@@ -0,0 +1,37 @@
+// Package auth decorates outgoing requests with whatever credentials the TM1 server expects.
+// Previously main.go injected credentials once, on the very first request, and relied on the
+// cookie jar to carry the resulting session for every request after that. That works for Basic and
+// CAM but not for bearer tokens, which TM1 expects on every request and which, for OIDC, expire and
+// need refreshing. Provider and Transport make that uniform: wrap a Client's Transport with a
+// Transport and every request it sends, including the delta polls inside tracker.EntityTracker.Run, gets
+// decorated the same way.
+package auth
+
+import "net/http"
+
+// Provider adds whatever headers a request needs to authenticate. Implementations must be safe
+// for concurrent use, since Transport may decorate requests from multiple goroutines at once.
+type Provider interface {
+	Decorate(req *http.Request) error
+}
+
+// Transport wraps Base, decorating every outgoing request with Provider before handing it off.
+type Transport struct {
+	Base     http.RoundTripper
+	Provider Provider
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Clone rather than mutate: http.RoundTripper implementations must not modify the original
+	// request.
+	req = req.Clone(req.Context())
+	if err := t.Provider.Decorate(req); err != nil {
+		return nil, err
+	}
+
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(req)
+}
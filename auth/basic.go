@@ -0,0 +1,31 @@
+package auth
+
+import (
+	b64 "encoding/base64"
+	"net/http"
+)
+
+// Basic authenticates using standard HTTP basic authentication, which is how TM1's own "TM1"
+// authentication mode maps onto the wire.
+type Basic struct {
+	Username string
+	Password string
+}
+
+func (a Basic) Decorate(req *http.Request) error {
+	req.SetBasicAuth(a.Username, a.Password)
+	return nil
+}
+
+// CAM authenticates against a Cognos Access Manager namespace.
+type CAM struct {
+	Username  string
+	Password  string
+	Namespace string
+}
+
+func (a CAM) Decorate(req *http.Request) error {
+	cred := b64.StdEncoding.EncodeToString([]byte(a.Username + ":" + a.Password + ":" + a.Namespace))
+	req.Header.Set("Authorization", "CAMNamespace "+cred)
+	return nil
+}
@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// bearerFilePollInterval is how often NewBearerFile checks the token file's modification time for
+// changes.
+const bearerFilePollInterval = 5 * time.Second
+
+// Bearer authenticates with a static bearer token, which may be refreshed at any time by rewriting
+// the file it was loaded from.
+type Bearer struct {
+	mu    sync.RWMutex
+	token string
+}
+
+// NewBearerStatic returns a Bearer carrying a fixed token that never changes.
+func NewBearerStatic(token string) *Bearer {
+	return &Bearer{token: token}
+}
+
+// NewBearerFile returns a Bearer whose token is read from path, and re-read whenever path's
+// modification time changes, so that rotating the token is as simple as rewriting the file.
+func NewBearerFile(path string) (*Bearer, error) {
+	b := &Bearer{}
+	if err := b.reload(path); err != nil {
+		return nil, err
+	}
+	go b.watch(path)
+	return b, nil
+}
+
+func (b *Bearer) reload(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	b.token = strings.TrimSpace(string(data))
+	b.mu.Unlock()
+	return nil
+}
+
+func (b *Bearer) watch(path string) {
+	var lastMod time.Time
+	if info, err := os.Stat(path); err == nil {
+		lastMod = info.ModTime()
+	}
+	for range time.Tick(bearerFilePollInterval) {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if info.ModTime().After(lastMod) {
+			lastMod = info.ModTime()
+			if err := b.reload(path); err != nil {
+				log.Println("auth: failed to reload bearer token from", path, ":", err)
+			}
+		}
+	}
+}
+
+func (b *Bearer) Decorate(req *http.Request) error {
+	b.mu.RLock()
+	token := b.token
+	b.mu.RUnlock()
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// oidcExpiryMargin is how far ahead of its expiry an access token is refreshed.
+const oidcExpiryMargin = 30 * time.Second
+
+// OIDC authenticates using the OAuth2 client-credentials flow against an OIDC token endpoint,
+// refreshing the access token shortly before it expires. Concurrent requests that notice the
+// cached token is due for renewal share a single refresh: the second and later callers simply wait
+// on the same mutex rather than each kicking off their own request to the token endpoint.
+type OIDC struct {
+	tokenURL     string
+	clientID     string
+	clientSecret string
+	scope        string
+	client       *http.Client
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+// NewOIDC returns an OIDC provider that authenticates against tokenURL with the given client
+// credentials. scope may be empty.
+func NewOIDC(tokenURL, clientID, clientSecret, scope string) *OIDC {
+	return &OIDC{
+		tokenURL:     tokenURL,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		scope:        scope,
+		client:       &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (o *OIDC) Decorate(req *http.Request) error {
+	token, err := o.accessToken()
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+func (o *OIDC) accessToken() (string, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.token != "" && time.Until(o.expiry) > oidcExpiryMargin {
+		return o.token, nil
+	}
+	return o.refreshLocked()
+}
+
+// refreshLocked fetches a new access token. Callers must hold o.mu.
+func (o *OIDC) refreshLocked() (string, error) {
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {o.clientID},
+		"client_secret": {o.clientSecret},
+	}
+	if o.scope != "" {
+		form.Set("scope", o.scope)
+	}
+
+	resp, err := o.client.PostForm(o.tokenURL, form)
+	if err != nil {
+		return "", fmt.Errorf("oidc: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("oidc: token endpoint responded with %s", resp.Status)
+	}
+
+	var body struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("oidc: %w", err)
+	}
+
+	o.token = body.AccessToken
+	o.expiry = time.Now().Add(time.Duration(body.ExpiresIn) * time.Second)
+	return o.token, nil
+}
@@ -0,0 +1,51 @@
+package checkpoint
+
+import (
+	bolt "go.etcd.io/bbolt"
+)
+
+var checkpointsBucket = []byte("checkpoints")
+
+// BoltCheckpointer persists deltaLinks in a BoltDB file, one key-value pair per entity set. It's
+// the optional alternative to FileCheckpointer for deployments that would rather not hand-roll
+// atomic updates to a JSON file, selected via TM1_CHECKPOINT_STORE=bolt.
+type BoltCheckpointer struct {
+	db *bolt.DB
+}
+
+// NewBoltCheckpointer opens (creating if necessary) a BoltDB file at path.
+func NewBoltCheckpointer(path string) (*BoltCheckpointer, error) {
+	db, err := bolt.Open(path, 0644, nil)
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(checkpointsBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltCheckpointer{db: db}, nil
+}
+
+func (b *BoltCheckpointer) Load(key string) (string, error) {
+	var deltaLink string
+	err := b.db.View(func(tx *bolt.Tx) error {
+		deltaLink = string(tx.Bucket(checkpointsBucket).Get([]byte(key)))
+		return nil
+	})
+	return deltaLink, err
+}
+
+func (b *BoltCheckpointer) Save(key, deltaLink string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(checkpointsBucket).Put([]byte(key), []byte(deltaLink))
+	})
+}
+
+// Close releases the underlying BoltDB file.
+func (b *BoltCheckpointer) Close() error {
+	return b.db.Close()
+}
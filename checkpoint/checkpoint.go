@@ -0,0 +1,18 @@
+// Package checkpoint provides durable storage for the deltaLink a tracker is currently positioned
+// at, so that restarting the process resumes where it left off instead of from "now" (losing
+// whatever the server logged while the tracker was down) or from the very beginning (re-emitting
+// everything). Implementations satisfy odata.Checkpointer structurally; this package only ever
+// constructs them, it doesn't need to import odata to do so.
+package checkpoint
+
+// Null is a Checkpointer that remembers nothing, restoring the original, in-memory-only, behavior.
+// It's the zero-configuration default.
+type Null struct{}
+
+func (Null) Load(key string) (string, error) {
+	return "", nil
+}
+
+func (Null) Save(key, deltaLink string) error {
+	return nil
+}
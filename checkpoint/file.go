@@ -0,0 +1,75 @@
+package checkpoint
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// FileCheckpointer persists deltaLinks, keyed by entity set name, as a single JSON object in a
+// local file. It's the simplest durable option and the one selected by TM1_CHECKPOINT_FILE.
+type FileCheckpointer struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewFileCheckpointer returns a FileCheckpointer backed by path. It's not an error for path not to
+// exist yet: any missing parent directories are created here, the file itself on the first Save.
+func NewFileCheckpointer(path string) *FileCheckpointer {
+	os.MkdirAll(filepath.Dir(path), 0755)
+	return &FileCheckpointer{path: path}
+}
+
+func (f *FileCheckpointer) Load(key string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	checkpoints, err := f.read()
+	if err != nil {
+		return "", err
+	}
+	return checkpoints[key], nil
+}
+
+func (f *FileCheckpointer) Save(key, deltaLink string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	checkpoints, err := f.read()
+	if err != nil {
+		return err
+	}
+	checkpoints[key] = deltaLink
+
+	encoded, err := json.Marshal(checkpoints)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file and rename it into place so a crash mid-write never leaves a
+	// truncated, unreadable checkpoint file behind.
+	tmp := f.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, encoded, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, f.path)
+}
+
+func (f *FileCheckpointer) read() (map[string]string, error) {
+	data, err := ioutil.ReadFile(f.path)
+	if os.IsNotExist(err) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	checkpoints := map[string]string{}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &checkpoints); err != nil {
+			return nil, err
+		}
+	}
+	return checkpoints, nil
+}
@@ -0,0 +1,35 @@
+// Package entities defines the Go shape of the TM1 entity sets the tracker knows how to follow,
+// beyond the MessageLogEntry the original sample was hard-wired to (see the logsink package for
+// that one).
+package entities
+
+// TransactionLogEntry defines the structure of a single TransactionLogEntries entity: a single
+// cell value change, identifying the cube and the element tuple it occurred at along with the
+// value before and after the change.
+type TransactionLogEntry struct {
+	ID          int
+	TimeStamp   string
+	User        string
+	Cube        string
+	Elements    []string
+	BeforeValue string
+	AfterValue  string
+}
+
+// Session defines the structure of a single Sessions entity: one connection a client currently has
+// open against the server.
+type Session struct {
+	ID      int
+	User    string
+	Context string
+}
+
+// Thread defines the structure of a single Threads entity: one worker thread of the server and
+// what it's currently doing.
+type Thread struct {
+	ID       int
+	Name     string
+	State    string
+	Function string
+	Object   string
+}
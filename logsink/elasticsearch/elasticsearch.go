@@ -0,0 +1,105 @@
+// Package elasticsearch implements the "elasticsearch" LogSink driver. Entries are batched and
+// shipped to an Elasticsearch cluster using the _bulk API, configured via TM1_ES_URL (required),
+// TM1_ES_INDEX (defaults to "tm1-log-tracker") and, optionally, TM1_ES_USERNAME/TM1_ES_PASSWORD.
+package elasticsearch
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/hubert-heijkers/tm1-log-tracker/logsink"
+)
+
+func init() {
+	logsink.Register("elasticsearch", New)
+}
+
+const defaultIndex = "tm1-log-tracker"
+
+type sink struct {
+	client   *http.Client
+	url      string
+	index    string
+	username string
+	password string
+	buffered []logsink.MessageLogEntry
+}
+
+// New constructs the elasticsearch driver.
+func New() (logsink.LogSink, error) {
+	url := os.Getenv("TM1_ES_URL")
+	if url == "" {
+		return nil, fmt.Errorf("elasticsearch: TM1_ES_URL must be set")
+	}
+	index := os.Getenv("TM1_ES_INDEX")
+	if index == "" {
+		index = defaultIndex
+	}
+	return &sink{
+		client:   &http.Client{},
+		url:      url,
+		index:    index,
+		username: os.Getenv("TM1_ES_USERNAME"),
+		password: os.Getenv("TM1_ES_PASSWORD"),
+	}, nil
+}
+
+func (s *sink) Write(entry logsink.MessageLogEntry) error {
+	s.buffered = append(s.buffered, entry)
+	// Keep the bulk request from growing without bound; ship what we have every 500 entries and
+	// let the tracker's own polling interval drive the rest through Flush.
+	if len(s.buffered) >= 500 {
+		return s.Flush()
+	}
+	return nil
+}
+
+func (s *sink) Flush() error {
+	if len(s.buffered) == 0 {
+		return nil
+	}
+
+	var body bytes.Buffer
+	for _, entry := range s.buffered {
+		action, err := json.Marshal(map[string]interface{}{"index": map[string]string{"_index": s.index}})
+		if err != nil {
+			return err
+		}
+		document, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		body.Write(action)
+		body.WriteByte('\n')
+		body.Write(document)
+		body.WriteByte('\n')
+	}
+
+	req, err := http.NewRequest("POST", s.url+"/_bulk", &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if s.username != "" {
+		req.SetBasicAuth(s.username, s.password)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("elasticsearch: bulk request failed with status %s", resp.Status)
+	}
+
+	s.buffered = s.buffered[:0]
+	return nil
+}
+
+func (s *sink) Close() error {
+	return s.Flush()
+}
@@ -0,0 +1,167 @@
+// Package gcplogs implements the "gcplogs" LogSink driver, modeled on Docker's gcplogs logging
+// driver. Entries are handed off to a bounded channel and shipped to Google Cloud Logging from a
+// dedicated goroutine so that a slow or unreachable Cloud Logging endpoint never blocks the
+// tracker's delta polling loop; once the buffer is full, entries are dropped rather than piling up
+// and Dropped is incremented so an operator can notice.
+package gcplogs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"cloud.google.com/go/logging"
+	"github.com/hubert-heijkers/tm1-log-tracker/logsink"
+	"google.golang.org/api/option"
+)
+
+func init() {
+	logsink.Register("gcplogs", New)
+}
+
+const (
+	bufferSize    = 4096
+	batchSize     = 1000
+	batchInterval = 5 * time.Second
+)
+
+// Dropped counts entries discarded because the buffer was full, i.e. Cloud Logging wasn't keeping
+// up. It is exported so callers, e.g. a future /metrics endpoint, can surface it.
+var Dropped int64
+
+type sink struct {
+	client   *logging.Client
+	logger   *logging.Logger
+	entries  chan logsink.MessageLogEntry
+	done     chan struct{}
+	finished chan struct{}
+}
+
+// New constructs the gcplogs driver. TM1_GCP_PROJECT is required; TM1_GCP_LOG_NAME defaults to
+// "tm1-log-tracker". Authentication follows the usual Application Default Credentials rules:
+// GOOGLE_APPLICATION_CREDENTIALS if set, otherwise the GCE/GKE metadata server.
+func New() (logsink.LogSink, error) {
+	project := os.Getenv("TM1_GCP_PROJECT")
+	if project == "" {
+		return nil, fmt.Errorf("gcplogs: TM1_GCP_PROJECT must be set")
+	}
+	logName := os.Getenv("TM1_GCP_LOG_NAME")
+	if logName == "" {
+		logName = "tm1-log-tracker"
+	}
+
+	var opts []option.ClientOption
+	if credentials := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"); credentials != "" {
+		opts = append(opts, option.WithCredentialsFile(credentials))
+	}
+
+	client, err := logging.NewClient(context.Background(), fmt.Sprintf("projects/%s", project), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("gcplogs: %w", err)
+	}
+
+	s := &sink{
+		client:   client,
+		logger:   client.Logger(logName),
+		entries:  make(chan logsink.MessageLogEntry, bufferSize),
+		done:     make(chan struct{}),
+		finished: make(chan struct{}),
+	}
+	go s.ship()
+	return s, nil
+}
+
+// Write enqueues entry for shipping. It never blocks: if the buffer is full the entry is dropped
+// and Dropped is incremented.
+func (s *sink) Write(entry logsink.MessageLogEntry) error {
+	select {
+	case s.entries <- entry:
+	default:
+		atomic.AddInt64(&Dropped, 1)
+	}
+	return nil
+}
+
+func (s *sink) Flush() error {
+	return s.logger.Flush()
+}
+
+func (s *sink) Close() error {
+	close(s.done)
+	<-s.finished
+	if err := s.logger.Flush(); err != nil {
+		s.client.Close()
+		return err
+	}
+	return s.client.Close()
+}
+
+// ship drains the buffer into Cloud Logging, batching up to batchSize entries or every
+// batchInterval, whichever comes first.
+func (s *sink) ship() {
+	ticker := time.NewTicker(batchInterval)
+	defer ticker.Stop()
+	defer close(s.finished)
+
+	batched := 0
+	for {
+		select {
+		case entry := <-s.entries:
+			s.logger.Log(toLoggingEntry(entry))
+			batched++
+			if batched >= batchSize {
+				s.logger.Flush()
+				batched = 0
+			}
+		case <-ticker.C:
+			if batched > 0 {
+				s.logger.Flush()
+				batched = 0
+			}
+		case <-s.done:
+			// Drain whatever is still sitting in the buffer rather than dropping it on the floor;
+			// a graceful shutdown should ship everything Write accepted.
+			for {
+				select {
+				case entry := <-s.entries:
+					s.logger.Log(toLoggingEntry(entry))
+					batched++
+				default:
+					if batched > 0 {
+						s.logger.Flush()
+					}
+					return
+				}
+			}
+		}
+	}
+}
+
+// toLoggingEntry maps a MessageLogEntry onto a Cloud Logging entry, translating its Level into the
+// corresponding logging.Severity and attaching the fields useful for filtering as labels.
+func toLoggingEntry(entry logsink.MessageLogEntry) logging.Entry {
+	return logging.Entry{
+		Severity: severity(entry.Level),
+		Payload:  entry.Message,
+		Labels: map[string]string{
+			"sessionId": fmt.Sprintf("%d", entry.SessionID),
+			"threadId":  fmt.Sprintf("%d", entry.ThreadID),
+			"logger":    entry.Logger,
+		},
+	}
+}
+
+func severity(level string) logging.Severity {
+	switch level {
+	case "WARN":
+		return logging.Warning
+	case "ERROR":
+		return logging.Error
+	case "FATAL":
+		return logging.Critical
+	default:
+		return logging.Info
+	}
+}
@@ -0,0 +1,58 @@
+// Package jsonfile implements the "jsonfile" LogSink driver: every entry is appended to a file as
+// a newline delimited JSON object, configured via TM1_JSONFILE_PATH.
+package jsonfile
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+
+	"github.com/hubert-heijkers/tm1-log-tracker/logsink"
+)
+
+func init() {
+	logsink.Register("jsonfile", New)
+}
+
+type sink struct {
+	file *os.File
+	w    *bufio.Writer
+}
+
+// New constructs the jsonfile driver. TM1_JSONFILE_PATH names the file to append to and defaults
+// to "tm1-log-tracker.jsonl"; the file is created if it doesn't already exist, its parent
+// directories are not.
+func New() (logsink.LogSink, error) {
+	path := os.Getenv("TM1_JSONFILE_PATH")
+	if path == "" {
+		path = "tm1-log-tracker.jsonl"
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &sink{file: file, w: bufio.NewWriter(file)}, nil
+}
+
+func (s *sink) Write(entry logsink.MessageLogEntry) error {
+	encoded, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if _, err := s.w.Write(encoded); err != nil {
+		return err
+	}
+	return s.w.WriteByte('\n')
+}
+
+func (s *sink) Flush() error {
+	return s.w.Flush()
+}
+
+func (s *sink) Close() error {
+	if err := s.Flush(); err != nil {
+		s.file.Close()
+		return err
+	}
+	return s.file.Close()
+}
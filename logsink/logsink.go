@@ -0,0 +1,91 @@
+// Package logsink defines the pluggable output side of the tracker. A MessageLogEntry, or any
+// entry synthesized from one (e.g. the MDX query duration records main.go derives), is handed to
+// a LogSink so that where it ends up - stdout, a file, Elasticsearch, Google Cloud Logging, a
+// webhook - is a matter of configuration rather than code.
+package logsink
+
+import (
+	"fmt"
+	"sync"
+)
+
+// MessageLogEntry mirrors the shape of a TM1 MessageLogEntries entity. It is also reused for
+// entries synthesized by the tracker itself (see main.go's MDX view accounting) so that both kinds
+// flow through the exact same sink pipeline.
+type MessageLogEntry struct {
+	SessionID int
+	ThreadID  int
+	Logger    string
+	Level     string
+	TimeStamp string
+	Message   string
+}
+
+// LogSink is implemented by every output driver. Write is called once per entry, in the order the
+// entries were produced. Flush asks the driver to push out anything it is still buffering, Close
+// releases whatever resources the driver holds on to and should Flush first. Drivers themselves
+// don't need to be safe for concurrent use - New wraps every one it constructs so Write/Flush/Close
+// serialize, since the same LogSink is shared between the tracker's poll loop and the rules
+// engine's asynchronous "sink" actions.
+type LogSink interface {
+	Write(entry MessageLogEntry) error
+	Flush() error
+	Close() error
+}
+
+// synchronizedSink serializes every call to an underlying LogSink so a driver whose Write/Flush
+// aren't otherwise safe for concurrent use - e.g. one built around a plain bufio.Writer - can be
+// shared between goroutines without a data race.
+type synchronizedSink struct {
+	mu sync.Mutex
+	LogSink
+}
+
+func (s *synchronizedSink) Write(entry MessageLogEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.LogSink.Write(entry)
+}
+
+func (s *synchronizedSink) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.LogSink.Flush()
+}
+
+func (s *synchronizedSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.LogSink.Close()
+}
+
+// Factory constructs a LogSink, reading whatever driver specific configuration it needs from the
+// environment.
+type Factory func() (LogSink, error)
+
+var drivers = map[string]Factory{}
+
+// Register makes a driver available under name. Drivers are expected to call this from an init()
+// function so that importing the driver package for its side effect, typically via a blank import
+// in main.go, is enough to make it selectable through TM1_LOG_SINK.
+func Register(name string, factory Factory) {
+	drivers[name] = factory
+}
+
+// New looks up the driver registered under name, typically the value of TM1_LOG_SINK, and
+// constructs it. If name is empty it defaults to "stdout-csv", matching the behavior of the
+// original sample implementation.
+func New(name string) (LogSink, error) {
+	if name == "" {
+		name = "stdout-csv"
+	}
+	factory, ok := drivers[name]
+	if !ok {
+		return nil, fmt.Errorf("logsink: no driver registered for %q", name)
+	}
+	sink, err := factory()
+	if err != nil {
+		return nil, err
+	}
+	return &synchronizedSink{LogSink: sink}, nil
+}
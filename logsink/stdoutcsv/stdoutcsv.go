@@ -0,0 +1,38 @@
+// Package stdoutcsv implements the "stdout-csv" LogSink driver: every entry is written to stdout
+// as a single comma separated line. This is the default driver and keeps the out-of-the-box
+// behavior of the original sample implementation.
+package stdoutcsv
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+
+	"github.com/hubert-heijkers/tm1-log-tracker/logsink"
+)
+
+func init() {
+	logsink.Register("stdout-csv", New)
+}
+
+type sink struct {
+	w *bufio.Writer
+}
+
+// New constructs the stdout-csv driver. It takes no configuration.
+func New() (logsink.LogSink, error) {
+	return &sink{w: bufio.NewWriter(os.Stdout)}, nil
+}
+
+func (s *sink) Write(entry logsink.MessageLogEntry) error {
+	_, err := fmt.Fprintf(s.w, "%s,%d,%d,%s,%s,%q\n", entry.Level, entry.SessionID, entry.ThreadID, entry.Logger, entry.TimeStamp, entry.Message)
+	return err
+}
+
+func (s *sink) Flush() error {
+	return s.w.Flush()
+}
+
+func (s *sink) Close() error {
+	return s.w.Flush()
+}
@@ -0,0 +1,60 @@
+// Package webhook implements the "webhook" LogSink driver: every entry is POSTed, as a JSON
+// object, to TM1_WEBHOOK_URL.
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/hubert-heijkers/tm1-log-tracker/logsink"
+)
+
+func init() {
+	logsink.Register("webhook", New)
+}
+
+// requestTimeout bounds how long a single delivery, called synchronously from the poll loop, is
+// allowed to take so a dead endpoint can't hang the tracker forever.
+const requestTimeout = 30 * time.Second
+
+type sink struct {
+	client *http.Client
+	url    string
+}
+
+// New constructs the webhook driver. TM1_WEBHOOK_URL must be set.
+func New() (logsink.LogSink, error) {
+	url := os.Getenv("TM1_WEBHOOK_URL")
+	if url == "" {
+		return nil, fmt.Errorf("webhook: TM1_WEBHOOK_URL must be set")
+	}
+	return &sink{client: &http.Client{Timeout: requestTimeout}, url: url}, nil
+}
+
+func (s *sink) Write(entry logsink.MessageLogEntry) error {
+	encoded, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(encoded))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook: endpoint responded with %s", resp.Status)
+	}
+	return nil
+}
+
+func (s *sink) Flush() error {
+	return nil
+}
+
+func (s *sink) Close() error {
+	return nil
+}
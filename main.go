@@ -1,40 +1,37 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
-	b64 "encoding/base64"
-	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"net/http/cookiejar"
 	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
 	"time"
 
+	"github.com/hubert-heijkers/tm1-log-tracker/auth"
+	"github.com/hubert-heijkers/tm1-log-tracker/checkpoint"
+	"github.com/hubert-heijkers/tm1-log-tracker/entities"
+	"github.com/hubert-heijkers/tm1-log-tracker/logsink"
+	_ "github.com/hubert-heijkers/tm1-log-tracker/logsink/elasticsearch"
+	_ "github.com/hubert-heijkers/tm1-log-tracker/logsink/gcplogs"
+	_ "github.com/hubert-heijkers/tm1-log-tracker/logsink/jsonfile"
+	_ "github.com/hubert-heijkers/tm1-log-tracker/logsink/stdoutcsv"
+	_ "github.com/hubert-heijkers/tm1-log-tracker/logsink/webhook"
+	"github.com/hubert-heijkers/tm1-log-tracker/rules"
+	"github.com/hubert-heijkers/tm1-log-tracker/tracker"
 	"github.com/hubert-heijkers/tm1-log-tracker/utils"
 	"github.com/joho/godotenv"
+	"golang.org/x/sync/errgroup"
 )
 
 // MessageLogEntry defines the structure of A single MessageLogEntry entity
-type MessageLogEntry struct {
-	SessionID int
-	ThreadID  int
-	Logger    string
-	Level     string
-	TimeStamp string // would have liked to use time.time but because some entries don't contain a proper time stamp the Go's time parser doesn't like it so we'll parse it later
-	Message   string
-}
-
-// MessageLogEntriesResponse defines the structure of an odata compliant response wrapping a MessageLogEntry collection
-type MessageLogEntriesResponse struct {
-	Context           string            `json:"@odata.context"`
-	Count             int               `json:"@odata.count"`
-	MessageLogEntries []MessageLogEntry `json:"value"`
-	NextLink          string            `json:"@odata.nextLink"`
-	DeltaLink         string            `json:"@odata.deltaLink"`
-}
+type MessageLogEntry = logsink.MessageLogEntry
 
 // Environment variables
 var tm1ServiceRootURL string
@@ -43,77 +40,93 @@ var interval int
 // The http client, extended with some odata functions, we'll use throughout.
 var client *odata.Client
 
+// sink is where the MDX query duration records derived below, and the entries written by any rule
+// with a "sink" action, end up; raw MessageLogEntries are not written to it.
+// Which driver backs it, and how that driver is configured, is controlled entirely through
+// environment variables - see the logsink package and its drivers for details.
+var sink logsink.LogSink
+
+// rulesEngine, when TM1_RULES_FILE is set, is evaluated against every entry before the MDX-view
+// accounting below gets a look at it. A nil engine means no rules were configured.
+var rulesEngine *rules.Engine
+
 // Some variables we use for this specific sample implemenation
 var threadMap map[int]time.Time
 var queryCount int
 var lastQuery time.Time
 
-// processMessageLogEntries is called every time the server has returned a response to either the
-// initial or any follow up delta requests. This function then unmarshals the JSON in the resonse
-// and iterates any message log entries contained within it.
-// This function 'processes' the entries one by one, in the same order as they were injected into
-// the message log of the server. Within one run of the server you will never miss any new entries
-// nor get any entry more then once for processing.
+// handleMessageLogEntry is called, by the MessageLogEntries EntityTracker, once for every entry
+// the server has logged, in the same order as they were injected into the message log of the
+// server. Within one run of the server you will never miss any new entries nor get any entry more
+// then once for processing.
 // Examples of what one could do here are:
 //  - Filter and/or store the entries in whatever shape or form in a file or database
 //  - Track the time it takes to execute an MDX query (the actual implementation of this sample)
 //  - Identify any specific pattern you'd be interested in and have the code notify you perhaps?
-func processMessageLogEntries(responseBody []byte) (string, string) {
+//    (see the rules package for that last one)
+func handleMessageLogEntry(entry MessageLogEntry) {
 
-	// Unmarshal the JSON response
-	res := MessageLogEntriesResponse{}
-	err := json.Unmarshal(responseBody, &res)
-	if err != nil {
-		log.Fatal(err)
+	// Give the rules engine, if one is configured, first look at every entry.
+	if rulesEngine != nil {
+		rulesEngine.Evaluate(entry)
 	}
 
-	// Interate over the message log entries retrieved from the server
-	for _, entry := range res.MessageLogEntries {
+	// This is where the action is! This sample implementation is only interested in MDX
+	// queries that are being processed by the server. This implementation keeps track of
+	// the begin and end times of the MDXViewCreate and dumps those time stamps, including
+	// the duration (time it took to create the view) into comma separated output which
+	// can be redirected to a file for further analysis.
+	if entry.Logger == "TM1.MdxViewCreate" {
 
-		// This is where the action is! This sample implementation is only interested in MDX
-		// queries that are being processed by the server. This implementation keeps track of
-		// the begin and end times of the MDXViewCreate and dumps those time stamps, including
-		// the duration (time it took to create the view) into comma separated output which
-		// can be redirected to a file for further analysis.
-		if entry.Logger == "TM1.MdxViewCreate" {
+		// Create a map, if not done so already, to keep track of MDX views that are being
+		// created and map the Thread ID to the start time
+		if threadMap == nil {
+			threadMap = make(map[int]time.Time)
+		}
 
-			// Create a map, if not done so already, to keep track of MDX views that are being
-			// created and map the Thread ID to the start time
-			if threadMap == nil {
-				threadMap = make(map[int]time.Time)
-			}
+		// Lookup this thread in the thread map
+		tsStart, rec := threadMap[entry.ThreadID]
 
-			// Lookup this thread in the thread map
-			tsStart, rec := threadMap[entry.ThreadID]
-
-			// Parse the time stamp for this entry
-			tsEntry, _ := time.Parse(time.RFC3339Nano, entry.TimeStamp)
-
-			// Is this the entry indicating that a new view was created?
-			if entry.Message == "View is created." {
-				// It is, increate the query count
-				queryCount++
-				// Presumably we recorded the start time as well...
-				if rec == true {
-					// We did, dump query count, start and end times as well as the duration to output
-					fmt.Printf("QUERY,%d,%s,%s,%0.3f\n", queryCount, tsStart.Format(time.RFC3339Nano), tsEntry.Format(time.RFC3339Nano), tsEntry.Sub(tsStart).Seconds())
-					delete(threadMap, entry.ThreadID)
-				} else {
-					fmt.Printf("ERROR,%d,ERROR,ERROR,0.000\n", queryCount)
-				}
+		// Parse the time stamp for this entry
+		tsEntry, _ := time.Parse(time.RFC3339Nano, entry.TimeStamp)
+
+		// Is this the entry indicating that a new view was created?
+		if entry.Message == "View is created." {
+			// It is, increate the query count
+			queryCount++
+			// Presumably we recorded the start time as well...
+			if rec == true {
+				// We did, write out a synthetic entry carrying the query count, start and end
+				// times as well as the duration, through the same sink every other entry goes
+				// through.
+				duration := tsEntry.Sub(tsStart).Seconds()
+				writeDerivedEntry(entry, "INFO", fmt.Sprintf("QUERY,%d,%s,%s,%0.3f", queryCount, tsStart.Format(time.RFC3339Nano), tsEntry.Format(time.RFC3339Nano), duration))
+				delete(threadMap, entry.ThreadID)
+			} else {
+				writeDerivedEntry(entry, "ERROR", fmt.Sprintf("ERROR,%d,ERROR,ERROR,0.000", queryCount))
+			}
+		} else {
+			// Not created so this is the message telling us which MDX we are about to create a view for
+			if rec == false {
+				threadMap[entry.ThreadID] = tsEntry
 			} else {
-				// Not created so this is the message telling us which MDX we are about to create a view for
-				if rec == false {
-					threadMap[entry.ThreadID] = tsEntry
-				} else {
-					fmt.Printf("ERROR,%d,VIEW CREATED EXPECTED,ERROR,0.000\n", queryCount)
-				}
+				writeDerivedEntry(entry, "ERROR", fmt.Sprintf("ERROR,%d,VIEW CREATED EXPECTED,ERROR,0.000", queryCount))
 			}
 		}
 	}
+}
 
-	// Return the nextLink and deltaLink, if there any
-	return res.NextLink, res.DeltaLink
+// writeDerivedEntry writes a MessageLogEntry synthesized from source, carrying message in place of
+// source's own Message, through the configured sink. A failure to write is logged rather than
+// fatal: a sink having trouble keeping up, e.g. a slow webhook endpoint, should never take down the
+// delta polling loop.
+func writeDerivedEntry(source MessageLogEntry, level, message string) {
+	derived := source
+	derived.Level = level
+	derived.Message = message
+	if err := sink.Write(derived); err != nil {
+		log.Println("Failed to write entry to log sink:", err)
+	}
 }
 
 func main() {
@@ -128,39 +141,100 @@ func main() {
 		interval = 5
 	}
 
-	// Turn 'Verbose' mode off
-	odata.Verbose = false
+	// Construct the configured log sink. TM1_LOG_SINK selects the driver (stdout-csv, jsonfile,
+	// elasticsearch, gcplogs or webhook) and defaults to stdout-csv, matching the original sample.
+	sink, err = logsink.New(os.Getenv("TM1_LOG_SINK"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer sink.Close()
 
-	// Create the one and only http client we'll be using, with a cookie jar enabled to keep reusing our session
-	tr := &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
-	client = &odata.Client{http.Client{Transport: tr}}
-	cookieJar, _ := cookiejar.New(nil)
-	client.Jar = cookieJar
+	// Load the rules engine, if TM1_RULES_FILE names one, and expose its per-rule match counters
+	// on a small /metrics HTTP endpoint in Prometheus text format.
+	if path := os.Getenv("TM1_RULES_FILE"); path != "" {
+		var err error
+		rulesEngine, err = rules.Load(path, sink)
+		if err != nil {
+			log.Fatal(err)
+		}
 
-	// Validate that the TM1 server is accessable by requesting the version of the server
-	req, _ := http.NewRequest("GET", tm1ServiceRootURL+"Configuration/ProductVersion/$value", nil)
+		metricsAddr := os.Getenv("TM1_METRICS_ADDR")
+		if metricsAddr == "" {
+			metricsAddr = ":9090"
+		}
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", rulesEngine.MetricsHandler())
+		go func() {
+			if err := http.ListenAndServe(metricsAddr, mux); err != nil {
+				log.Println("Metrics server stopped:", err)
+			}
+		}()
+	}
+
+	// Install a context that is cancelled on SIGINT/SIGTERM so Ctrl-C (or a container orchestrator
+	// asking us to stop) flushes the sink and exits cleanly instead of leaving the delta
+	// subscription dangling.
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-	// Since this is our initial request we'll have to provide credentials to be able to authenticate.
-	// We support Basic and CAM authentication modes in this example. The authentication mode used is
-	// defined by the TM1_AUTHENTICATION environment variable and, if specified, needs to be either
-	// "TM1", to use standard TM1 authentication, or "CAM" to use CAM. If no value is specified it
-	// defaults to attempting Basic authentication.
-	// Note: One could get fancy and issue a request against the server and respond to a 401 by checking
-	// the WWW-Authorization header to find out what security is supported by the server if one wanted.
+	// Turn 'Verbose' mode off
+	odata.Verbose = false
+
+	// Build the AuthProvider for the configured authentication mode. TM1_AUTHENTICATION selects
+	// the mode and defaults to "TM1" (Basic), matching the original sample. Unlike the original,
+	// which injected credentials once on the very first request and relied on the cookie jar to
+	// carry the resulting session from then on, every mode here decorates every request - which is
+	// what BEARER and OIDC need, since their tokens expire.
+	// Note: One could get fancy and issue a request against the server and respond to a 401 by
+	// checking the WWW-Authorization header to find out what security is supported by the server
+	// if one wanted.
+	var authProvider auth.Provider
 	switch os.Getenv("TM1_AUTHENTICATION") {
 	case "CAM":
-		// Add the Authorization header triggering the CAM authentication
-		cred := b64.StdEncoding.EncodeToString([]byte(os.Getenv("TM1_USER") + ":" + os.Getenv("TM1_PASSWORD") + ":" + os.Getenv("TM1_CAM_NAMESPACE")))
-		req.Header.Add("Authorization", "CAMNamespace "+cred)
+		authProvider = auth.CAM{
+			Username:  os.Getenv("TM1_USER"),
+			Password:  os.Getenv("TM1_PASSWORD"),
+			Namespace: os.Getenv("TM1_CAM_NAMESPACE"),
+		}
+
+	case "BEARER":
+		if tokenFile := os.Getenv("TM1_BEARER_TOKEN_FILE"); tokenFile != "" {
+			var err error
+			authProvider, err = auth.NewBearerFile(tokenFile)
+			if err != nil {
+				log.Fatal(err)
+			}
+		} else {
+			authProvider = auth.NewBearerStatic(os.Getenv("TM1_BEARER_TOKEN"))
+		}
+
+	case "OIDC":
+		authProvider = auth.NewOIDC(
+			os.Getenv("TM1_OIDC_TOKEN_URL"),
+			os.Getenv("TM1_OIDC_CLIENT_ID"),
+			os.Getenv("TM1_OIDC_CLIENT_SECRET"),
+			os.Getenv("TM1_OIDC_SCOPE"),
+		)
 
 	case "TM1":
 		fallthrough
 
 	default:
-		// TM1 authentication maps to basic HTTP authentication, set accordingly
-		req.SetBasicAuth(os.Getenv("TM1_USER"), os.Getenv("TM1_PASSWORD"))
+		// TM1 authentication maps to basic HTTP authentication
+		authProvider = auth.Basic{Username: os.Getenv("TM1_USER"), Password: os.Getenv("TM1_PASSWORD")}
 	}
 
+	// Create the one and only http client we'll be using, with a cookie jar enabled to keep reusing
+	// our session and every request decorated by authProvider.
+	tr := &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	client = &odata.Client{Client: http.Client{Transport: &auth.Transport{Base: tr, Provider: authProvider}}}
+	cookieJar, _ := cookiejar.New(nil)
+	client.Jar = cookieJar
+
+	// Validate that the TM1 server is accessable by requesting the version of the server
+	req, _ := http.NewRequest("GET", tm1ServiceRootURL+"Configuration/ProductVersion/$value", nil)
+	req = req.WithContext(ctx)
+
 	// We'll expect text back in this case but we'll simply dump the content out and won't do any
 	// content type verification here
 	req.Header.Add("Accept", "*/*")
@@ -188,8 +262,91 @@ func main() {
 		log.Fatalln("The TM1 Server version of your server is:", string(version), "\n Minimal required version to use a tracker is 10.2.2 FP5!")
 	}
 
-	// Track the collection of transaction log entries. This will query the existing entries and
-	// then cause the server to query the delta of the collection (read: just the changes) after
-	// a defined duration.
-	client.TrackCollection(tm1ServiceRootURL, "MessageLogEntries", time.Duration(interval)*time.Second, processMessageLogEntries)
+	// Durably checkpoint the deltaLink we're positioned at so a restart resumes where we left off.
+	// TM1_CHECKPOINT_FILE selects the file the driver persists to; without it, checkpointing is
+	// skipped entirely, matching the original in-memory-only behavior. TM1_CHECKPOINT_STORE picks
+	// the driver itself - "file" (the default) or "bolt" for the BoltDB-backed one.
+	var checkpointer odata.Checkpointer = checkpoint.Null{}
+	if path := os.Getenv("TM1_CHECKPOINT_FILE"); path != "" {
+		switch store := os.Getenv("TM1_CHECKPOINT_STORE"); store {
+		case "", "file":
+			checkpointer = checkpoint.NewFileCheckpointer(path)
+		case "bolt":
+			boltCheckpointer, err := checkpoint.NewBoltCheckpointer(path)
+			if err != nil {
+				log.Fatal("Failed to open checkpoint store:", err)
+			}
+			defer boltCheckpointer.Close()
+			checkpointer = boltCheckpointer
+		default:
+			log.Fatalf("Unknown TM1_CHECKPOINT_STORE %q; expected \"file\" or \"bolt\"", store)
+		}
+	}
+
+	// Build the trackers for every entity set this binary knows how to follow. Each gets its own
+	// sink pipeline - MessageLogEntries' is the fully pluggable one built in the logsink package,
+	// the others are a simpler newline delimited JSON pipeline, independently configurable via
+	// their own TM1_..._SINK_FILE environment variable (defaulting to stdout) - and all of them
+	// share the one authenticated client, cookie jar and Checkpointer.
+	messageLogTracker := tracker.New("MessageLogEntries", handleMessageLogEntry)
+	messageLogTracker.Flush = sink.Flush
+
+	transactionLogSink := jsonSinkFor[entities.TransactionLogEntry]("TM1_TRANSACTIONLOG_SINK_FILE")
+	defer transactionLogSink.Close()
+	transactionLogTracker := tracker.New("TransactionLogEntries", func(entry entities.TransactionLogEntry) {
+		if err := transactionLogSink.Write(entry); err != nil {
+			log.Println("Failed to write transaction log entry:", err)
+		}
+	})
+	transactionLogTracker.Flush = transactionLogSink.Flush
+
+	// Sessions and Threads are current-state collections, not delta-trackable ones: there's no
+	// deltaLink to resume from, so the tracker re-polls the whole collection every interval.
+	sessionsSink := jsonSinkFor[entities.Session]("TM1_SESSIONS_SINK_FILE")
+	defer sessionsSink.Close()
+	sessionsTracker := tracker.New("Sessions", func(session entities.Session) {
+		if err := sessionsSink.Write(session); err != nil {
+			log.Println("Failed to write session:", err)
+		}
+	})
+	sessionsTracker.Delta = false
+	sessionsTracker.Flush = sessionsSink.Flush
+
+	threadsSink := jsonSinkFor[entities.Thread]("TM1_THREADS_SINK_FILE")
+	defer threadsSink.Close()
+	threadsTracker := tracker.New("Threads", func(thread entities.Thread) {
+		if err := threadsSink.Write(thread); err != nil {
+			log.Println("Failed to write thread:", err)
+		}
+	})
+	threadsTracker.Delta = false
+	threadsTracker.Flush = threadsSink.Flush
+
+	// Run every tracker concurrently under one errgroup.Group sharing ctx: if any one of them
+	// returns an unrecoverable error the others are cancelled too, and main waits for all of them
+	// to unwind before the deferred sink Closes run.
+	g, gctx := errgroup.WithContext(ctx)
+	pollInterval := time.Duration(interval) * time.Second
+	g.Go(func() error { return messageLogTracker.Run(gctx, client, tm1ServiceRootURL, pollInterval, checkpointer) })
+	g.Go(func() error { return transactionLogTracker.Run(gctx, client, tm1ServiceRootURL, pollInterval, checkpointer) })
+	g.Go(func() error { return sessionsTracker.Run(gctx, client, tm1ServiceRootURL, pollInterval, checkpointer) })
+	g.Go(func() error { return threadsTracker.Run(gctx, client, tm1ServiceRootURL, pollInterval, checkpointer) })
+
+	if err := g.Wait(); err != nil && ctx.Err() == nil {
+		log.Println("Tracker stopped:", err)
+	}
+}
+
+// jsonSinkFor returns a newline delimited JSON Sink for T, writing to the file named by the
+// envVar environment variable, or to stdout if it's unset.
+func jsonSinkFor[T any](envVar string) tracker.Sink[T] {
+	path := os.Getenv(envVar)
+	if path == "" {
+		return tracker.NewJSONSink[T](os.Stdout)
+	}
+	sink, err := tracker.NewJSONFileSink[T](path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return sink
 }
@@ -0,0 +1,70 @@
+package rules
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/hubert-heijkers/tm1-log-tracker/logsink"
+	"github.com/hubert-heijkers/tm1-log-tracker/utils"
+)
+
+// webhookTimeout bounds how long a single webhook delivery attempt, including retries, is allowed
+// to take so a dead endpoint can't accumulate goroutines forever.
+const webhookTimeout = 30 * time.Second
+
+// webhookPayload is the JSON body posted to a "webhook" action's URL.
+type webhookPayload struct {
+	Rule  string                  `json:"rule"`
+	Entry logsink.MessageLogEntry `json:"entry"`
+}
+
+// postWebhook POSTs entry, along with the name of the rule that matched it, to url. It retries on
+// network errors and 429/5xx responses using the exact same retry/backoff policy the OData client
+// uses for its own requests.
+func postWebhook(url, ruleName string, entry logsink.MessageLogEntry) error {
+	encoded, err := json.Marshal(webhookPayload{Rule: ruleName, Entry: entry})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+
+	resp, err := odata.Retry(ctx, odata.DefaultRetryPolicy, func() (*http.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(encoded))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return http.DefaultClient.Do(req)
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook endpoint responded with %s", resp.Status)
+	}
+	return nil
+}
+
+// runCommand runs command with the matched entry's fields passed through the environment, so
+// operators can write simple shell scripts without having to parse JSON.
+func runCommand(command, ruleName string, entry logsink.MessageLogEntry) error {
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Env = append(os.Environ(),
+		"TM1_RULE_NAME="+ruleName,
+		"TM1_ENTRY_LOGGER="+entry.Logger,
+		"TM1_ENTRY_LEVEL="+entry.Level,
+		"TM1_ENTRY_MESSAGE="+entry.Message,
+		fmt.Sprintf("TM1_ENTRY_SESSION_ID=%d", entry.SessionID),
+		fmt.Sprintf("TM1_ENTRY_THREAD_ID=%d", entry.ThreadID),
+	)
+	return cmd.Run()
+}
@@ -0,0 +1,21 @@
+package rules
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+)
+
+// MetricsHandler returns an http.Handler exposing, in Prometheus text exposition format, how many
+// times each loaded rule has matched. It's meant to be mounted at /metrics alongside the tracker so
+// operators can build dashboards and alerts on top of it.
+func (e *Engine) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		fmt.Fprintln(w, "# HELP tm1_log_tracker_rule_matches_total Number of times a rule's filters and pattern matched an entry.")
+		fmt.Fprintln(w, "# TYPE tm1_log_tracker_rule_matches_total counter")
+		for _, rule := range e.rules {
+			fmt.Fprintf(w, "tm1_log_tracker_rule_matches_total{rule=%q} %d\n", rule.Name, atomic.LoadInt64(&rule.matches))
+		}
+	})
+}
@@ -0,0 +1,182 @@
+// Package rules turns "identify any specific pattern you'd be interested in and have the code
+// notify you", the comment that used to be the only hint main.go gave towards this, into an actual
+// subsystem. Rules are loaded from a YAML or JSON file, matched against every entry the tracker
+// sees, and trigger one or more actions - a webhook, writing to the configured log sink, or
+// running a command - when they do.
+package rules
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hubert-heijkers/tm1-log-tracker/logsink"
+	"gopkg.in/yaml.v3"
+)
+
+// Action describes a single reaction to a rule matching. Type selects which of URL or Command is
+// used: "webhook" POSTs to URL, "sink" writes the entry to the configured LogSink, "exec" runs
+// Command.
+type Action struct {
+	Type    string `yaml:"type" json:"type"`
+	URL     string `yaml:"url,omitempty" json:"url,omitempty"`
+	Command string `yaml:"command,omitempty" json:"command,omitempty"`
+}
+
+// Duration wraps time.Duration so rules files can write a debounce window as a plain string, e.g.
+// "30s" or "5m", instead of a raw integer count of nanoseconds.
+type Duration struct {
+	time.Duration
+}
+
+// UnmarshalYAML parses d from a duration string such as "30s".
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = parsed
+	return nil
+}
+
+// UnmarshalJSON parses d from a duration string such as "30s".
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = parsed
+	return nil
+}
+
+// Rule matches entries against an optional set of filters and a required regular expression
+// against the message text, then fires its actions - at most once per Debounce window.
+type Rule struct {
+	Name      string   `yaml:"name" json:"name"`
+	Logger    string   `yaml:"logger,omitempty" json:"logger,omitempty"`
+	Level     string   `yaml:"level,omitempty" json:"level,omitempty"`
+	SessionID *int     `yaml:"sessionId,omitempty" json:"sessionId,omitempty"`
+	Pattern   string   `yaml:"pattern" json:"pattern"`
+	Debounce  Duration `yaml:"debounce,omitempty" json:"debounce,omitempty"`
+	Actions   []Action `yaml:"actions" json:"actions"`
+
+	regex     *regexp.Regexp
+	matches   int64
+	mu        sync.Mutex
+	lastFired time.Time
+}
+
+// match reports whether entry satisfies the rule's filters and pattern.
+func (r *Rule) match(entry logsink.MessageLogEntry) bool {
+	if r.Logger != "" && r.Logger != entry.Logger {
+		return false
+	}
+	if r.Level != "" && r.Level != entry.Level {
+		return false
+	}
+	if r.SessionID != nil && *r.SessionID != entry.SessionID {
+		return false
+	}
+	return r.regex.MatchString(entry.Message)
+}
+
+// due reports whether enough time has passed since the rule last fired, and if so marks it as
+// having fired now.
+func (r *Rule) due() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if time.Since(r.lastFired) < r.Debounce.Duration {
+		return false
+	}
+	r.lastFired = time.Now()
+	return true
+}
+
+// Engine evaluates every loaded Rule against every entry the tracker processes.
+type Engine struct {
+	rules []*Rule
+	sink  logsink.LogSink
+}
+
+// Load reads rules from path, which is parsed as JSON if it has a .json extension and as YAML
+// otherwise, and returns an Engine ready to Evaluate entries against them. Actions of type "sink"
+// write to sink.
+func Load(path string, sink logsink.LogSink) (*Engine, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var parsed []*Rule
+	if strings.HasSuffix(path, ".json") {
+		err = json.Unmarshal(data, &parsed)
+	} else {
+		err = yaml.Unmarshal(data, &parsed)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("rules: failed to parse %s: %w", path, err)
+	}
+
+	for _, rule := range parsed {
+		rule.regex, err = regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("rules: rule %q has an invalid pattern: %w", rule.Name, err)
+		}
+	}
+
+	return &Engine{rules: parsed, sink: sink}, nil
+}
+
+// Evaluate runs entry through every rule, in the order they appear in the rules file, firing the
+// actions of any rule whose filters and pattern match and which isn't within its debounce window.
+// Actions run asynchronously so a slow or unreachable webhook endpoint never blocks the tracker.
+func (e *Engine) Evaluate(entry logsink.MessageLogEntry) {
+	for _, rule := range e.rules {
+		if !rule.match(entry) {
+			continue
+		}
+		atomic.AddInt64(&rule.matches, 1)
+		if !rule.due() {
+			continue
+		}
+		for _, action := range rule.Actions {
+			go e.run(rule, action, entry)
+		}
+	}
+}
+
+func (e *Engine) run(rule *Rule, action Action, entry logsink.MessageLogEntry) {
+	var err error
+	switch action.Type {
+	case "webhook":
+		err = postWebhook(action.URL, rule.Name, entry)
+	case "sink":
+		err = e.writeToSink(rule.Name, entry)
+	case "exec":
+		err = runCommand(action.Command, rule.Name, entry)
+	default:
+		err = fmt.Errorf("unknown action type %q", action.Type)
+	}
+	if err != nil {
+		fmt.Println("rules: action for rule", rule.Name, "failed:", err)
+	}
+}
+
+func (e *Engine) writeToSink(ruleName string, entry logsink.MessageLogEntry) error {
+	derived := entry
+	derived.Logger = "tm1-log-tracker.rules." + ruleName
+	return e.sink.Write(derived)
+}
@@ -0,0 +1,61 @@
+package tracker
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+)
+
+// Sink is the generic counterpart to logsink.LogSink for entity types other than MessageLogEntry:
+// each built-in tracker gets its own, independently configured, pipeline to write what it sees to.
+type Sink[T any] interface {
+	Write(entity T) error
+	Flush() error
+	Close() error
+}
+
+// jsonSink writes every entity as a newline delimited JSON object.
+type jsonSink[T any] struct {
+	w      *bufio.Writer
+	closer io.Closer
+}
+
+// NewJSONSink wraps w as a Sink that never needs closing, e.g. os.Stdout.
+func NewJSONSink[T any](w io.Writer) Sink[T] {
+	return &jsonSink[T]{w: bufio.NewWriter(w)}
+}
+
+// NewJSONFileSink appends newline delimited JSON to the file at path, creating it if necessary.
+func NewJSONFileSink[T any](path string) (Sink[T], error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &jsonSink[T]{w: bufio.NewWriter(file), closer: file}, nil
+}
+
+func (s *jsonSink[T]) Write(entity T) error {
+	encoded, err := json.Marshal(entity)
+	if err != nil {
+		return err
+	}
+	if _, err := s.w.Write(encoded); err != nil {
+		return err
+	}
+	return s.w.WriteByte('\n')
+}
+
+func (s *jsonSink[T]) Flush() error {
+	return s.w.Flush()
+}
+
+func (s *jsonSink[T]) Close() error {
+	if err := s.Flush(); err != nil {
+		return err
+	}
+	if s.closer != nil {
+		return s.closer.Close()
+	}
+	return nil
+}
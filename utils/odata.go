@@ -1,161 +1,230 @@
-package odata
-
-import (
-	"fmt"
-	"io/ioutil"
-	"log"
-	"net/http"
-	"strings"
-	"time"
-)
-
-var Verbose = true
-
-type Client struct {
-	http.Client
-}
-
-func (client *Client) ExecuteGETRequest(urlStr string) *http.Response {
-	// Create new, GET, request
-	req, _ := http.NewRequest("GET", urlStr, nil)
-	// Add the OData-Version header
-	req.Header.Add("OData-Version", "4.0")
-	// We'll be expecting a JSON formatted response, set Accept header accordingly
-	req.Header.Add("Accept", "application/json")
-	if Verbose == true {
-		fmt.Println(req.Method, req.URL)
-	}
-	// Execute the request
-	resp, err := client.Do(req)
-	// If no errors then return the response
-	if err != nil {
-		log.Fatal(err)
-	}
-	return resp
-}
-
-func (client *Client) ExecuteGETRequestEx(urlStr string, preReq func(*http.Request)) *http.Response {
-	// Create new, GET, request
-	req, _ := http.NewRequest("GET", urlStr, nil)
-	// Add the OData-Version header
-	req.Header.Add("OData-Version", "4.0")
-	// We'll be expecting a JSON formatted response, set Accept header accordingly
-	req.Header.Add("Accept", "application/json")
-	// Allow additional processing of the request before actually executing
-	preReq(req)
-	if Verbose == true {
-		fmt.Println(req.Method, req.URL)
-	}
-	// Execute the request
-	resp, err := client.Do(req)
-	// If no errors then return the response
-	if err != nil {
-		log.Fatal(err)
-	}
-	return resp
-}
-
-func (client *Client) ExecutePOSTRequest(urlStr, contentType, body string) *http.Response {
-	// Create new, POST, request
-	req, _ := http.NewRequest("POST", urlStr, strings.NewReader(body))
-	req.Header.Add("Content-Type", contentType)
-	// Add the OData-Version header
-	req.Header.Add("OData-Version", "4.0")
-	// We'll be expecting a JSON formatted response, set Accept header accordingly
-	req.Header.Add("Accept", "application/json")
-	if Verbose == true {
-		fmt.Println(req.Method, req.URL)
-		fmt.Println(body)
-	}
-	// Execute the request
-	resp, err := client.Do(req)
-	// If no errors then return the response
-	if err != nil {
-		log.Fatal(err)
-	}
-	return resp
-}
-
-func (client *Client) ExecutePOSTRequestEx(urlStr, contentType, body string, preReq func(*http.Request)) *http.Response {
-	// Create new, POST, request
-	req, _ := http.NewRequest("POST", urlStr, strings.NewReader(body))
-	req.Header.Add("Content-Type", contentType)
-	// Add the OData-Version header
-	req.Header.Add("OData-Version", "4.0")
-	// We'll be expecting a JSON formatted response, set Accept header accordingly
-	req.Header.Add("Accept", "application/json")
-	// Allow additional processing of the request before actually executing
-	preReq(req)
-	if Verbose == true {
-		fmt.Println(req.Method, req.URL)
-		fmt.Println(body)
-	}
-	// Execute the request
-	resp, err := client.Do(req)
-	// If no errors then return the response
-	if err != nil {
-		log.Fatal(err)
-	}
-	return resp
-}
-
-func (client *Client) IterateCollection(datasourceServiceRootURL string, urlStr string, processResponse func([]byte) (int, string)) {
-	// Set up the request to retrieve the collection given the passed url
-	// Note: While we are requesting the collection completely in one request, the service might
-	// opt to apply server driven paging and give us a partial response with a nextLink which
-	// subsequently can be used to retrieve the next chunk or remainder of the collection.
-	for nextLink := urlStr; nextLink != ""; {
-		resp := client.ExecuteGETRequest(datasourceServiceRootURL + nextLink)
-		defer resp.Body.Close()
-		body, _ := ioutil.ReadAll(resp.Body)
-		if Verbose == true {
-			fmt.Println(string(body))
-		}
-
-		// Process the response
-		_, nextLink = processResponse(body)
-	}
-}
-
-func (client *Client) TrackCollection(serviceRootURL string, urlStr string, interval time.Duration, processResponse func([]byte) (string, string)) {
-	// Set up the request to retrieve the collection given the passed url
-	// Note: While we are requesting the collection completely in one request, the service might
-	// opt to apply server driven paging and give us a partial response with a nextLink which
-	// subsequently can be used to retrieve the next chunk or remainder of the collection.
-	for urlStr := urlStr; urlStr != ""; {
-		resp := client.ExecuteGETRequestEx(serviceRootURL+urlStr, func(req *http.Request) { req.Header.Add("Prefer", "odata.track-changes") })
-		defer resp.Body.Close()
-		body, _ := ioutil.ReadAll(resp.Body)
-		if Verbose == true {
-			fmt.Println(string(body))
-		}
-
-		// Process the response
-		nextLink, deltaLink := processResponse(body)
-
-		// TM1 doesn't but other services could return a nextLink when applying server side windowing
-		// while returning the collection. Note that, following OData conventions, only the last
-		// window, which does not have a nextLink, contains a deltaLink.
-		if nextLink != "" {
-			// Continue processing the collection being returned
-			urlStr = nextLink
-		} else if deltaLink != "" {
-			// Wait a second before querying for the next deltaLink
-			time.Sleep(interval)
-
-			// Continue with the deltaLink
-			urlStr = deltaLink
-		} else {
-			// Seems the server is no longer willing to give us deltas.
-			break
-		}
-	}
-}
-
-func ValidateStatusCode(resp *http.Response, statusCode int, logFmt func() string) {
-	if resp.StatusCode != statusCode {
-		defer resp.Body.Close()
-		body, _ := ioutil.ReadAll(resp.Body)
-		log.Fatal(logFmt() + "\r\nServer responded with: " + resp.Status + "\r\n" + string(body))
-	}
-}
+package odata
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var Verbose = true
+
+// RetryPolicy controls how the client retries a request after a network error or a 5xx/429
+// response. Backoff grows exponentially from InitialBackoff up to MaxBackoff, and each wait is then
+// lengthened or shortened at random by up to Jitter fraction so that a fleet of trackers doesn't retry in
+// lockstep. A Retry-After header on the response, when present, takes precedence over the computed
+// backoff.
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Jitter         float64
+}
+
+// DefaultRetryPolicy is used by any Client whose Retry field is left at its zero value.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    5,
+	InitialBackoff: 500 * time.Millisecond,
+	MaxBackoff:     30 * time.Second,
+	Jitter:         0.2,
+}
+
+func (p RetryPolicy) orDefault() RetryPolicy {
+	if p.MaxAttempts == 0 {
+		return DefaultRetryPolicy
+	}
+	return p
+}
+
+// backoff returns how long to wait after attempt (1-based) has failed, before the next one.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	wait := p.InitialBackoff * time.Duration(1<<uint(attempt-1))
+	if wait > p.MaxBackoff || wait <= 0 {
+		wait = p.MaxBackoff
+	}
+	jitter := 1 + p.Jitter*(rand.Float64()*2-1)
+	return time.Duration(float64(wait) * jitter)
+}
+
+type Client struct {
+	http.Client
+	Retry RetryPolicy
+}
+
+// isRetryable reports whether err or resp warrant another attempt: network errors, and 429 or any
+// 5xx response.
+func isRetryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
+
+// retryAfter looks at a response's Retry-After header, returning the duration to wait and whether
+// one was present. Only the delta-seconds form is supported; TM1 and the services we front for it
+// don't send the HTTP-date form.
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	seconds, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+// Retry calls attempt, retrying on network errors and 429/5xx responses per policy. It's exported
+// so that code outside this package wanting the exact same retry/backoff behavior, e.g. the rules
+// engine's webhook action, doesn't have to reimplement it. ctx governs both the overall deadline
+// and the waits between attempts.
+func Retry(ctx context.Context, policy RetryPolicy, attempt func() (*http.Response, error)) (*http.Response, error) {
+	policy = policy.orDefault()
+
+	var lastErr error
+	for n := 1; n <= policy.MaxAttempts; n++ {
+		resp, err := attempt()
+		if !isRetryable(resp, err) {
+			return resp, err
+		}
+		lastErr = err
+		if lastErr == nil {
+			lastErr = fmt.Errorf("odata: server responded with %s", resp.Status)
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+
+		if n == policy.MaxAttempts {
+			break
+		}
+
+		wait := policy.backoff(n)
+		if afterWait, ok := retryAfter(resp); ok {
+			wait = afterWait
+		}
+		log.Printf("odata: request failed (%v), retrying in %s (attempt %d/%d)", lastErr, wait, n, policy.MaxAttempts)
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+	return nil, lastErr
+}
+
+// do executes newReq (called once per attempt, since a request's body can only be read once) and
+// retries it, per client.Retry, using Retry.
+func (client *Client) do(ctx context.Context, newReq func() (*http.Request, error)) (*http.Response, error) {
+	return Retry(ctx, client.Retry, func() (*http.Response, error) {
+		req, err := newReq()
+		if err != nil {
+			return nil, err
+		}
+		req = req.WithContext(ctx)
+
+		if Verbose == true {
+			fmt.Println(req.Method, req.URL)
+		}
+
+		return client.Do(req)
+	})
+}
+
+func (client *Client) ExecuteGETRequest(ctx context.Context, urlStr string) (*http.Response, error) {
+	return client.ExecuteGETRequestEx(ctx, urlStr, func(*http.Request) {})
+}
+
+func (client *Client) ExecuteGETRequestEx(ctx context.Context, urlStr string, preReq func(*http.Request)) (*http.Response, error) {
+	return client.do(ctx, func() (*http.Request, error) {
+		req, err := http.NewRequest("GET", urlStr, nil)
+		if err != nil {
+			return nil, err
+		}
+		// Add the OData-Version header
+		req.Header.Add("OData-Version", "4.0")
+		// We'll be expecting a JSON formatted response, set Accept header accordingly
+		req.Header.Add("Accept", "application/json")
+		// Allow additional processing of the request before actually executing
+		preReq(req)
+		return req, nil
+	})
+}
+
+func (client *Client) ExecutePOSTRequest(ctx context.Context, urlStr, contentType, body string) (*http.Response, error) {
+	return client.ExecutePOSTRequestEx(ctx, urlStr, contentType, body, func(*http.Request) {})
+}
+
+func (client *Client) ExecutePOSTRequestEx(ctx context.Context, urlStr, contentType, body string, preReq func(*http.Request)) (*http.Response, error) {
+	return client.do(ctx, func() (*http.Request, error) {
+		req, err := http.NewRequest("POST", urlStr, strings.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Add("Content-Type", contentType)
+		// Add the OData-Version header
+		req.Header.Add("OData-Version", "4.0")
+		// We'll be expecting a JSON formatted response, set Accept header accordingly
+		req.Header.Add("Accept", "application/json")
+		// Allow additional processing of the request before actually executing
+		preReq(req)
+		if Verbose == true {
+			fmt.Println(body)
+		}
+		return req, nil
+	})
+}
+
+func (client *Client) IterateCollection(ctx context.Context, datasourceServiceRootURL string, urlStr string, processResponse func([]byte) (int, string)) error {
+	// Set up the request to retrieve the collection given the passed url
+	// Note: While we are requesting the collection completely in one request, the service might
+	// opt to apply server driven paging and give us a partial response with a nextLink which
+	// subsequently can be used to retrieve the next chunk or remainder of the collection.
+	for nextLink := urlStr; nextLink != ""; {
+		resp, err := client.ExecuteGETRequest(ctx, datasourceServiceRootURL+nextLink)
+		if err != nil {
+			return err
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		if Verbose == true {
+			fmt.Println(string(body))
+		}
+
+		// Process the response
+		_, nextLink = processResponse(body)
+	}
+	return nil
+}
+
+// Checkpointer durably records the deltaLink a tracker is currently positioned at, keyed by entity
+// set name, so that a restarted tracker resumes from there instead of from the initial collection
+// URL (losing whatever the server logged while the tracker was down). The
+// github.com/hubert-heijkers/tm1-log-tracker/checkpoint package provides implementations; pass nil
+// to keep the original, in-memory-only, behavior. See the tracker package's EntityTracker, which is
+// what actually drives a Checkpointer through its Load/Save pair.
+type Checkpointer interface {
+	Load(key string) (string, error)
+	Save(key, deltaLink string) error
+}
+
+func ValidateStatusCode(resp *http.Response, statusCode int, logFmt func() string) {
+	if resp.StatusCode != statusCode {
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		log.Fatal(logFmt() + "\r\nServer responded with: " + resp.Status + "\r\n" + string(body))
+	}
+}